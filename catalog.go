@@ -0,0 +1,314 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// catalog holds the columns, keys, indexes, types, kinds and comments of a
+// set of tables in one schema, read with one query each instead of one per
+// table. Its methods fall back to the per-table queries for tables it
+// wasn't loaded with, and a nil catalog always does.
+type catalog struct {
+	tables           map[string]bool
+	kinds            map[string]string
+	columns          map[string][]columnMeta
+	primaryKeys      map[string][]string
+	uniqueKeys       map[string][]string
+	partitionKeys    map[string][]string
+	tableComments    map[string]string
+	columnComments   map[string]map[string]string
+	domains          map[string]map[string]string
+	indexedColumns   map[string][]string
+	indexExpressions map[string][]string
+	uniqueIndexes    map[string][]uniqueIndex
+	foreignKeys      map[string][]foreignKey
+	enums            map[string][]enumMeta
+	composites       map[string][]compositeMeta
+}
+
+// loadCatalog reads the catalog of the given tables of schema.
+func loadCatalog(db *sql.DB, schema string, tables []string, opts genOptions) (*catalog, error) {
+	c := &catalog{
+		tables:         make(map[string]bool, len(tables)),
+		kinds:          map[string]string{},
+		columns:        map[string][]columnMeta{},
+		primaryKeys:    map[string][]string{},
+		tableComments:  map[string]string{},
+		columnComments: map[string]map[string]string{},
+	}
+	for _, t := range tables {
+		c.tables[t] = true
+	}
+	names := pq.Array(tables)
+
+	const columnsQ = `
+select
+  c.table_name,
+  c.column_name,
+  c.udt_name,
+  c.is_nullable = 'YES' as is_nullable,
+  c.is_identity = 'YES' as is_identity,
+  c.is_generated = 'ALWAYS' as is_generated,
+  c.column_default
+from information_schema.columns c
+where c.table_schema = $1
+  and c.table_name = any($2)
+order by c.table_name, c.ordinal_position`
+	rows, err := db.Query(columnsQ, schema, names)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var t string
+		var m columnMeta
+		if err := rows.Scan(&t, &m.Name, &m.UDTName, &m.IsNullable, &m.IsIdentity, &m.IsGenerated, &m.ColumnDefault); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c.columns[t] = append(c.columns[t], m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	const primaryKeysQ = `
+select tc.table_name, kcu.column_name
+from information_schema.table_constraints tc
+join information_schema.key_column_usage kcu
+  on tc.constraint_name = kcu.constraint_name
+  and tc.table_schema = kcu.table_schema
+  and tc.table_name = kcu.table_name
+where tc.table_schema = $1
+  and tc.table_name = any($2)
+  and tc.constraint_type = 'PRIMARY KEY'
+order by tc.table_name, kcu.ordinal_position`
+	if err := scanPairs(db, primaryKeysQ, schema, names, func(t, col string) {
+		c.primaryKeys[t] = append(c.primaryKeys[t], col)
+	}); err != nil {
+		return nil, err
+	}
+
+	const kindsQ = `
+select c.relname, c.relkind::text
+from pg_catalog.pg_class c
+join pg_catalog.pg_namespace n on c.relnamespace = n.oid
+where n.nspname = $1
+  and c.relname = any($2)`
+	if err := scanPairs(db, kindsQ, schema, names, func(t, kind string) {
+		c.kinds[t] = kind
+	}); err != nil {
+		return nil, err
+	}
+
+	const tableCommentsQ = `
+select c.relname, coalesce(d.description, '')
+from pg_catalog.pg_class c
+join pg_catalog.pg_namespace n on c.relnamespace = n.oid
+left join pg_catalog.pg_description d on d.objoid = c.oid and d.objsubid = 0
+where n.nspname = $1
+  and c.relname = any($2)`
+	if err := scanPairs(db, tableCommentsQ, schema, names, func(t, desc string) {
+		c.tableComments[t] = desc
+	}); err != nil {
+		return nil, err
+	}
+
+	const columnCommentsQ = `
+select
+  c.relname,
+  a.attname,
+  coalesce(d.description, '')
+from pg_catalog.pg_attribute a
+join pg_catalog.pg_class c on a.attrelid = c.oid
+join pg_catalog.pg_namespace n on c.relnamespace = n.oid
+left join pg_catalog.pg_description d on d.objoid = c.oid and d.objsubid = a.attnum
+where n.nspname = $1
+  and c.relname = any($2)
+  and a.attnum > 0
+  and not a.attisdropped`
+	rows, err = db.Query(columnCommentsQ, schema, names)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t, name, desc string
+		if err := rows.Scan(&t, &name, &desc); err != nil {
+			return nil, err
+		}
+		if c.columnComments[t] == nil {
+			c.columnComments[t] = map[string]string{}
+		}
+		c.columnComments[t][name] = desc
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if c.uniqueKeys, err = readUniqueKeyColumns(db, schema, tables); err != nil {
+		return nil, err
+	}
+	if c.partitionKeys, err = readPartitionPrimaryKeyColumns(db, schema, tables); err != nil {
+		return nil, err
+	}
+	if c.domains, err = readDomainBaseTypes(db, schema, tables); err != nil {
+		return nil, err
+	}
+	if c.indexedColumns, err = readIndexedColumns(db, schema, tables); err != nil {
+		return nil, err
+	}
+	if c.indexExpressions, err = readIndexExpressions(db, schema, tables); err != nil {
+		return nil, err
+	}
+	if c.uniqueIndexes, err = readUniqueIndexes(db, schema, tables); err != nil {
+		return nil, err
+	}
+	if c.foreignKeys, err = readForeignKeys(db, schema, tables); err != nil {
+		return nil, err
+	}
+	if c.enums, err = readEnums(db, schema, tables, opts); err != nil {
+		return nil, err
+	}
+	if c.composites, err = readComposites(db, schema, tables, opts); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// scanPairs runs a query returning two text columns and calls fn per row.
+func scanPairs(db *sql.DB, q string, schema string, names any, fn func(a, b string)) error {
+	rows, err := db.Query(q, schema, names)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a, b string
+		if err := rows.Scan(&a, &b); err != nil {
+			return err
+		}
+		fn(a, b)
+	}
+	return rows.Err()
+}
+
+func (c *catalog) has(table string) bool {
+	return c != nil && c.tables[table]
+}
+
+// readColumns returns a copy, as introspect edits the columns in place.
+// Materialized views, which information_schema leaves out, are read alone.
+func (c *catalog) readColumns(db *sql.DB, schema, table string) ([]columnMeta, error) {
+	if !c.has(table) || len(c.columns[table]) == 0 {
+		return readColumns(db, schema, table)
+	}
+	return append([]columnMeta(nil), c.columns[table]...), nil
+}
+
+func (c *catalog) readRelKind(db *sql.DB, schema, table string) (string, error) {
+	if !c.has(table) {
+		return readRelKind(db, schema, table)
+	}
+	return c.kinds[table], nil
+}
+
+func (c *catalog) readPrimaryKeyColumns(db *sql.DB, schema, table string) ([]string, error) {
+	if !c.has(table) {
+		return readPrimaryKeyColumns(db, schema, table)
+	}
+	return c.primaryKeys[table], nil
+}
+
+func (c *catalog) readUniqueKeyColumns(db *sql.DB, schema, table string) ([]string, error) {
+	if !c.has(table) {
+		m, err := readUniqueKeyColumns(db, schema, []string{table})
+		return m[table], err
+	}
+	return c.uniqueKeys[table], nil
+}
+
+func (c *catalog) readPartitionPrimaryKeyColumns(db *sql.DB, schema, table string) ([]string, error) {
+	if !c.has(table) {
+		m, err := readPartitionPrimaryKeyColumns(db, schema, []string{table})
+		return m[table], err
+	}
+	return c.partitionKeys[table], nil
+}
+
+func (c *catalog) readTableComment(db *sql.DB, schema, table string) (string, error) {
+	if !c.has(table) {
+		return readTableComment(db, schema, table)
+	}
+	return c.tableComments[table], nil
+}
+
+func (c *catalog) readColumnComments(db *sql.DB, schema, table string) (map[string]string, error) {
+	if !c.has(table) {
+		return readColumnComments(db, schema, table)
+	}
+	return c.columnComments[table], nil
+}
+
+func (c *catalog) readDomainBaseTypes(db *sql.DB, schema, table string) (map[string]string, error) {
+	if !c.has(table) {
+		m, err := readDomainBaseTypes(db, schema, []string{table})
+		return m[table], err
+	}
+	return c.domains[table], nil
+}
+
+func (c *catalog) readIndexedColumns(db *sql.DB, schema, table string) ([]string, error) {
+	if !c.has(table) {
+		m, err := readIndexedColumns(db, schema, []string{table})
+		return m[table], err
+	}
+	return c.indexedColumns[table], nil
+}
+
+func (c *catalog) readIndexExpressions(db *sql.DB, schema, table string) ([]string, error) {
+	if !c.has(table) {
+		m, err := readIndexExpressions(db, schema, []string{table})
+		return m[table], err
+	}
+	return c.indexExpressions[table], nil
+}
+
+func (c *catalog) readUniqueIndexes(db *sql.DB, schema, table string) ([]uniqueIndex, error) {
+	if !c.has(table) {
+		m, err := readUniqueIndexes(db, schema, []string{table})
+		return m[table], err
+	}
+	return c.uniqueIndexes[table], nil
+}
+
+// readForeignKeys returns a copy, as introspect fills in the columns.
+func (c *catalog) readForeignKeys(db *sql.DB, schema, table string) ([]foreignKey, error) {
+	if !c.has(table) {
+		m, err := readForeignKeys(db, schema, []string{table})
+		return m[table], err
+	}
+	fks := append([]foreignKey(nil), c.foreignKeys[table]...)
+	for i := range fks {
+		fks[i].Columns = append([]column(nil), fks[i].Columns...)
+	}
+	return fks, nil
+}
+
+func (c *catalog) readEnums(db *sql.DB, schema, table string, opts genOptions) ([]enumMeta, error) {
+	if !c.has(table) {
+		m, err := readEnums(db, schema, []string{table}, opts)
+		return m[table], err
+	}
+	return c.enums[table], nil
+}
+
+func (c *catalog) readComposites(db *sql.DB, schema, table string, opts genOptions) ([]compositeMeta, error) {
+	if !c.has(table) {
+		m, err := readComposites(db, schema, []string{table}, opts)
+		return m[table], err
+	}
+	return c.composites[table], nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the content of a --config file. Top-level keys are named
+// after the command-line flags (url, schema, dir, with-custom, ...) and
+// provide their defaults; the tables list adds per-table overrides.
+type fileConfig struct {
+	Flags  map[string]string
+	Tables []tableConfig
+}
+
+// tableConfig overrides the output location and struct name of a table.
+// Name is a table name or, for dir and package, a pattern like those of
+// --include, e.g. auth.* for every table of schema auth; the first entry
+// that matches applies. Type, like --table name:Type, needs a bare table
+// name and applies to that table in every schema. Only plain names are
+// generated without --all-tables.
+type tableConfig struct {
+	Name    string `yaml:"name"`
+	Dir     string `yaml:"dir"`
+	Package string `yaml:"package"`
+	Type    string `yaml:"type"`
+}
+
+func loadConfig(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	cfg := &fileConfig{Flags: map[string]string{}}
+	for key, node := range raw {
+		if key == "tables" {
+			if err := node.Decode(&cfg.Tables); err != nil {
+				return nil, fmt.Errorf("parse %s: tables: %w", path, err)
+			}
+			continue
+		}
+		value, err := flagValue(node)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %s: %w", path, key, err)
+		}
+		cfg.Flags[key] = value
+	}
+	for i, t := range cfg.Tables {
+		if t.Name == "" {
+			return nil, fmt.Errorf("parse %s: tables[%d]: missing name", path, i)
+		}
+		if _, err := globList(t.Name); err != nil {
+			return nil, fmt.Errorf("parse %s: tables[%d]: name %w", path, i, err)
+		}
+		if t.Type != "" && strings.ContainsAny(t.Name, ".*?[") {
+			return nil, fmt.Errorf("parse %s: tables[%d]: type needs a bare table name, not %q", path, i, t.Name)
+		}
+	}
+	return cfg, nil
+}
+
+// flagValue converts a YAML scalar (or a list of scalars, joined with commas)
+// into the string form accepted by flag.Set.
+func flagValue(node yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Value, nil
+	case yaml.SequenceNode:
+		items := make([]string, 0, len(node.Content))
+		for _, n := range node.Content {
+			if n.Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("list items must be scalars")
+			}
+			items = append(items, n.Value)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("expected a scalar or a list")
+	}
+}
+
+// apply sets every flag that has a config value and was not given explicitly
+// on the command line, so explicit flags always win.
+func (c *fileConfig) apply(fs *flag.FlagSet) error {
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	for key, value := range c.Flags {
+		if fs.Lookup(key) == nil || key == "config" {
+			return fmt.Errorf("config: unknown key %q", key)
+		}
+		if explicit[key] {
+			continue
+		}
+		if err := fs.Set(key, value); err != nil {
+			return fmt.Errorf("config: %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// table returns the first override matching schema.table, if any.
+func (c *fileConfig) table(schema, name string) (tableConfig, bool) {
+	if c == nil {
+		return tableConfig{}, false
+	}
+	for _, t := range c.Tables {
+		if matchTable(t.Name, schema, name) {
+			return t, true
+		}
+	}
+	return tableConfig{}, false
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// connParams are the --host, --port, --user and --dbname flags used when
+// --url is empty. Empty values fall back to PGHOST, PGPORT, PGUSER and
+// PGDATABASE.
+type connParams struct {
+	Host   string
+	Port   string
+	User   string
+	DBName string
+}
+
+// dsn builds a lib/pq key=value connection string. The password is taken
+// from PGPASSWORD or the password file, never from a flag, so it doesn't
+// show up in process listings. The result holds the password: callers must
+// not print it, and the errors returned here never contain it.
+func (p connParams) dsn() (string, error) {
+	p.Host = envDefault(p.Host, "PGHOST")
+	p.Port = envDefault(p.Port, "PGPORT")
+	p.User = envDefault(p.User, "PGUSER")
+	p.DBName = envDefault(p.DBName, "PGDATABASE")
+	if p.DBName == "" {
+		return "", fmt.Errorf("missing --dbname (or PGDATABASE)")
+	}
+	if p.Port != "" {
+		if n, err := strconv.Atoi(p.Port); err != nil || n <= 0 || n > 65535 {
+			return "", fmt.Errorf("invalid --port %q", p.Port)
+		}
+	}
+
+	password := os.Getenv("PGPASSWORD")
+	if password == "" {
+		password = p.pgpass()
+	}
+
+	var parts []string
+	add := func(key, value string) {
+		if value != "" {
+			parts = append(parts, key+"="+quoteDSNValue(value))
+		}
+	}
+	add("host", p.Host)
+	add("port", p.Port)
+	add("user", p.User)
+	add("dbname", p.DBName)
+	add("password", password)
+	return strings.Join(parts, " "), nil
+}
+
+func envDefault(value, env string) string {
+	if value != "" {
+		return value
+	}
+	return os.Getenv(env)
+}
+
+// quoteDSNValue quotes a value for a key=value connection string.
+func quoteDSNValue(v string) string {
+	r := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return "'" + r.Replace(v) + "'"
+}
+
+// pgpass looks the password up in PGPASSFILE or ~/.pgpass the way libpq
+// does: the first hostname:port:database:username:password line matching
+// the connection wins, and * matches anything. Like libpq it ignores a file
+// that is readable by group or others. It returns "" when nothing matches.
+func (p connParams) pgpass() string {
+	path := os.Getenv("PGPASSFILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		path = filepath.Join(home, ".pgpass")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	if st, err := f.Stat(); err != nil || st.Mode().Perm()&0o077 != 0 {
+		fmt.Fprintf(os.Stderr, "warning: password file %s has group or world access; ignoring it\n", path)
+		return ""
+	}
+
+	host := p.Host
+	if host == "" || strings.HasPrefix(host, "/") {
+		host = "localhost"
+	}
+	port := p.Port
+	if port == "" {
+		port = "5432"
+	}
+	usr := p.User
+	if usr == "" {
+		if u, err := user.Current(); err == nil {
+			usr = u.Username
+		}
+	}
+	want := []string{host, port, p.DBName, usr}
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := splitPgpassLine(line)
+		if len(fields) != 5 {
+			continue
+		}
+		match := true
+		for i, w := range want {
+			if fields[i] != "*" && fields[i] != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			return fields[4]
+		}
+	}
+	return ""
+}
+
+// splitPgpassLine splits a password file line on the colons that are not
+// escaped with a backslash, unescaping \: and \\.
+func splitPgpassLine(line string) []string {
+	var fields []string
+	var sb strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\' && i+1 < len(line):
+			i++
+			sb.WriteByte(line[i])
+		case c == ':' && len(fields) < 4:
+			fields = append(fields, sb.String())
+			sb.Reset()
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return append(fields, sb.String())
+}
+
+// maxRetryDelay caps the doubling delay between connection attempts.
+const maxRetryDelay = 30 * time.Second
+
+// connect pings the database before any introspection, so a wrong address
+// or password fails with a message naming the server instead of somewhere
+// inside the first query. Each attempt waits at most timeout (no limit when
+// it is <= 0). Connection-level failures are retried up to retries times,
+// sleeping delay before the first retry and twice as long before each next
+// one; server errors such as a bad password are not.
+func (g *generator) connect(dsn string, timeout time.Duration, retries int, delay time.Duration) error {
+	params := dsnParams(dsn)
+	addr := net.JoinHostPort(params["host"], params["port"])
+	for attempt := 1; ; attempt++ {
+		err := ping(g.db, timeout)
+		if err == nil {
+			return nil
+		}
+		msg := err.Error()
+		if errors.Is(err, context.DeadlineExceeded) {
+			msg = fmt.Sprintf("no answer within %s (see --connect-timeout)", timeout)
+		}
+		if pw := params["password"]; pw != "" {
+			msg = strings.ReplaceAll(msg, pw, "xxxxx")
+		}
+		// A URL that doesn't parse is quoted whole in the error.
+		msg = urlPassword.ReplaceAllString(msg, "${1}xxxxx@")
+
+		if attempt > retries || !retryable(err) {
+			return fmt.Errorf("could not connect to postgres at %s: %s", addr, msg)
+		}
+		g.verbose("connect failed, retrying", "addr", addr, "attempt", attempt, "retry_in", delay, "error", msg)
+		time.Sleep(delay)
+		delay = min(2*delay, maxRetryDelay)
+	}
+}
+
+func ping(db *sql.DB, timeout time.Duration) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return db.PingContext(ctx)
+}
+
+// retryable reports whether a failed ping may succeed later: the server
+// can't be reached yet, dropped the connection or is still starting up.
+// Errors reported by the server (bad password, unknown database) and
+// malformed URLs are final.
+func retryable(err error) bool {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return false
+	}
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		return pgErr.SQLState() == "57P03" // cannot_connect_now
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, driver.ErrBadConn)
+}
+
+// urlPassword matches the password of a URL's user info.
+var urlPassword = regexp.MustCompile(`(://[^:/@\s]*:)[^@\s]*@`)
+
+// dsnParams returns the settings of a postgres:// URL or a key=value
+// connection string, with host and port defaulted the way lib/pq does.
+func dsnParams(dsn string) map[string]string {
+	params := map[string]string{}
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		for key, values := range u.Query() {
+			params[key] = values[0]
+		}
+		if h := u.Hostname(); h != "" {
+			params["host"] = h
+		}
+		if p := u.Port(); p != "" {
+			params["port"] = p
+		}
+		if pw, ok := u.User.Password(); ok {
+			params["password"] = pw
+		}
+	} else {
+		for key, value := range splitKeyValues(dsn) {
+			params[key] = value
+		}
+	}
+	if params["host"] = envDefault(params["host"], "PGHOST"); params["host"] == "" {
+		params["host"] = "localhost"
+	}
+	if params["port"] = envDefault(params["port"], "PGPORT"); params["port"] == "" {
+		params["port"] = "5432"
+	}
+	return params
+}
+
+// splitKeyValues parses a key=value connection string, unquoting values
+// written by quoteDSNValue.
+func splitKeyValues(dsn string) map[string]string {
+	out := map[string]string{}
+	for s := strings.TrimSpace(dsn); s != ""; s = strings.TrimSpace(s) {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		key = strings.TrimSpace(key)
+		rest = strings.TrimLeft(rest, " ")
+		var sb strings.Builder
+		if strings.HasPrefix(rest, "'") {
+			i := 1
+			for ; i < len(rest) && rest[i] != '\''; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				sb.WriteByte(rest[i])
+			}
+			s = rest[min(i+1, len(rest)):]
+		} else {
+			value, tail, _ := strings.Cut(rest, " ")
+			sb.WriteString(value)
+			s = tail
+		}
+		out[key] = sb.String()
+	}
+	return out
+}
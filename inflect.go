@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// uncountable words are the same in singular and plural.
+var uncountable = map[string]bool{
+	"audio": true, "data": true, "equipment": true, "feedback": true,
+	"info": true, "information": true, "metadata": true, "money": true,
+	"news": true, "series": true, "sheep": true, "species": true,
+}
+
+// irregularPlurals maps singular to plural for the words the suffix rules
+// get wrong.
+var irregularPlurals = map[string]string{
+	"cache": "caches", "child": "children", "datum": "data", "foot": "feet",
+	"goose": "geese", "man": "men", "mouse": "mice", "movie": "movies",
+	"person": "people", "tooth": "teeth", "woman": "women",
+}
+
+var irregularSingulars = func() map[string]string {
+	m := make(map[string]string, len(irregularPlurals))
+	for s, p := range irregularPlurals {
+		m[p] = s
+	}
+	return m
+}()
+
+// pluralize returns the plural of the last word of a snake_case or
+// CamelCase name, so order_item gives order_items and OrderItem gives
+// OrderItems. The English rules cover typical table names, not the whole
+// language.
+func pluralize(s string) string {
+	return inflectLastWord(s, func(w string) string {
+		if uncountable[w] {
+			return w
+		}
+		if p, ok := irregularPlurals[w]; ok {
+			return p
+		}
+		switch {
+		case strings.HasSuffix(w, "us"):
+			return w + "es"
+		case strings.HasSuffix(w, "is"):
+			return w[:len(w)-2] + "es"
+		case strings.HasSuffix(w, "y") && len(w) > 1 && !strings.ContainsRune("aeiou", rune(w[len(w)-2])):
+			return w[:len(w)-1] + "ies"
+		case strings.HasSuffix(w, "s"), strings.HasSuffix(w, "x"), strings.HasSuffix(w, "z"),
+			strings.HasSuffix(w, "ch"), strings.HasSuffix(w, "sh"):
+			return w + "es"
+		}
+		return w + "s"
+	})
+}
+
+// singularize is the inverse of pluralize.
+func singularize(s string) string {
+	return inflectLastWord(s, func(w string) string {
+		if uncountable[w] {
+			return w
+		}
+		if sg, ok := irregularSingulars[w]; ok {
+			return sg
+		}
+		switch {
+		case strings.HasSuffix(w, "ouses"), strings.HasSuffix(w, "auses"):
+			return w[:len(w)-1]
+		case strings.HasSuffix(w, "uses"):
+			return w[:len(w)-2]
+		case strings.HasSuffix(w, "yses"):
+			return w[:len(w)-2] + "is"
+		case strings.HasSuffix(w, "ies") && len(w) > 3:
+			return w[:len(w)-3] + "y"
+		case strings.HasSuffix(w, "sses"), strings.HasSuffix(w, "xes"), strings.HasSuffix(w, "zes"),
+			strings.HasSuffix(w, "ches"), strings.HasSuffix(w, "shes"):
+			return w[:len(w)-2]
+		case strings.HasSuffix(w, "ss"), strings.HasSuffix(w, "us"), strings.HasSuffix(w, "is"):
+			return w
+		case strings.HasSuffix(w, "s"):
+			return w[:len(w)-1]
+		}
+		return w
+	})
+}
+
+// inflectLastWord applies fn to the lower-cased last word of s and restores
+// the case of that word: Capitalized or ALL CAPS words stay that way.
+func inflectLastWord(s string, fn func(string) string) string {
+	start := strings.LastIndexAny(s, "_-") + 1
+	for i := len(s) - 1; i > start; i-- {
+		if unicode.IsUpper(rune(s[i])) && !unicode.IsUpper(rune(s[i-1])) {
+			start = i
+			break
+		}
+	}
+	word := s[start:]
+	if word == "" {
+		return s
+	}
+	out := fn(strings.ToLower(word))
+	switch {
+	case len(word) > 1 && strings.ToUpper(word) == word:
+		out = strings.ToUpper(out)
+	case unicode.IsUpper(rune(word[0])):
+		out = strings.ToUpper(out[:1]) + out[1:]
+	}
+	return s[:start] + out
+}
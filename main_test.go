@@ -0,0 +1,948 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// testTable is a table of the catalog the tests introspect, so they run
+// without a database.
+type testTable struct {
+	schema  string // public when empty
+	name    string
+	columns []columnMeta
+	pk      []string
+	indexed []string
+	uniques []uniqueIndex
+	exprs   []string // indexExpressions entries
+	fks     []foreignKey
+	enums   []enumMeta
+	comps   []compositeMeta
+}
+
+// catalog returns the catalog loadCatalog would read for the table alone.
+func (tt testTable) catalog() *catalog {
+	return &catalog{
+		tables:           map[string]bool{tt.name: true},
+		kinds:            map[string]string{tt.name: "r"},
+		columns:          map[string][]columnMeta{tt.name: tt.columns},
+		primaryKeys:      map[string][]string{tt.name: tt.pk},
+		uniqueKeys:       map[string][]string{},
+		partitionKeys:    map[string][]string{},
+		tableComments:    map[string]string{},
+		columnComments:   map[string]map[string]string{},
+		domains:          map[string]map[string]string{},
+		indexedColumns:   map[string][]string{tt.name: tt.indexed},
+		indexExpressions: map[string][]string{tt.name: tt.exprs},
+		uniqueIndexes:    map[string][]uniqueIndex{tt.name: tt.uniques},
+		foreignKeys:      map[string][]foreignKey{tt.name: tt.fks},
+		enums:            map[string][]enumMeta{tt.name: tt.enums},
+		composites:       map[string][]compositeMeta{tt.name: tt.comps},
+	}
+}
+
+// testOptions returns the options of a run with the default flags, so
+// names follow --acronyms legacy.
+func testOptions() genOptions {
+	return genOptions{
+		WithCustom:       true,
+		SoftDeleteColumn: "deleted_at",
+		CreatedAtColumn:  "created_at",
+		UpdatedAtColumn:  "updated_at",
+		Timestamps:       "go",
+		VersionColumn:    "version",
+		UUIDType:         "string",
+		JSONType:         "string",
+		IntWidth:         "64",
+		FloatWidth:       "64",
+		NoTimestamp:      true,
+		Immutable:        map[string]bool{"created_at": true},
+	}
+}
+
+// introspectTest introspects tt with opts.
+func introspectTest(t *testing.T, tt testTable, opts genOptions) tableMeta {
+	t.Helper()
+	schema := tt.schema
+	if schema == "" {
+		schema = "public"
+	}
+	meta, err := introspect(nil, tt.catalog(), schema, tt.name, opts)
+	if err != nil {
+		t.Fatalf("introspect %s: %v", tt.name, err)
+	}
+	return meta
+}
+
+// renderTest renders tpl for meta and fails unless the result is valid Go.
+func renderTest(t *testing.T, tpl string, meta tableMeta) string {
+	t.Helper()
+	src, err := render(tpl, map[string]any{
+		"Package": "model",
+		"Meta":    meta,
+		"URLEnv":  testURLEnv,
+	}, testOptions())
+	if err != nil {
+		t.Fatalf("render %s: %v", meta.Table, err)
+	}
+	return string(src)
+}
+
+// generateTest runs the generator with opts for tt alone and returns the
+// directory it wrote the package to.
+func generateTest(t *testing.T, tt testTable, opts genOptions) string {
+	t.Helper()
+	schema := tt.schema
+	if schema == "" {
+		schema = "public"
+	}
+	dir := t.TempDir()
+	g := &generator{opts: opts, written: map[string]bool{}, typeFiles: map[string]string{}, bundles: map[string]*bundle{}}
+	j := &tableJob{schema: schema, table: tt.name, dir: dir, pkg: "model", cat: tt.catalog()}
+	if _, err := g.generate(j); err != nil {
+		t.Fatalf("generate %s: %v", tt.name, err)
+	}
+	return dir
+}
+
+// typeCheck type-checks the Go files in dir, tests included, as one package.
+// The packages outside the standard library aren't dependencies of the
+// generator, so they are imported empty and the errors about their members
+// are ignored; what is left are mistakes in how the generated files use
+// each other.
+func typeCheck(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) != ".go" {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, e.Name()), nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+
+	std := importer.Default()
+	stubs := map[string]bool{}
+	conf := types.Config{
+		Importer: importerFunc(func(p string) (*types.Package, error) {
+			if !strings.Contains(strings.Split(p, "/")[0], ".") {
+				return std.Import(p)
+			}
+			name := path.Base(p)
+			if regexp.MustCompile(`^v[0-9]+$`).MatchString(name) {
+				name = path.Base(path.Dir(p))
+			}
+			stubs[name] = true
+			pkg := types.NewPackage(p, name)
+			pkg.MarkComplete()
+			return pkg, nil
+		}),
+		Error: func(err error) {
+			msg := err.(types.Error).Msg
+			if name, _, ok := strings.Cut(strings.TrimPrefix(msg, "undefined: "), "."); ok && msg != "" && stubs[name] {
+				return
+			}
+			t.Error(err)
+		},
+	}
+	conf.Check("model", fset, files, nil)
+}
+
+// goTest adds files, named by file name, to the package in dir and runs its
+// tests. Unlike typeCheck it builds against the real dependencies, which go
+// mod tidy downloads, so it's skipped with -short or when that fails.
+func goTest(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("downloads the dependencies of the generated code")
+	}
+	// go-zero is required up front: looking its packages up by path fails
+	// with proxies that answer 403 for the paths that aren't modules.
+	files["go.mod"] = "module model\n\ngo 1.21\n\nrequire github.com/zeromicro/go-zero v1.10.3\n"
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tidy := exec.Command("go", "mod", "tidy")
+	tidy.Dir = dir
+	if out, err := tidy.CombinedOutput(); err != nil {
+		t.Skipf("go mod tidy: %v\n%s", err, out)
+	}
+	test := exec.Command("go", "test", ".")
+	test.Dir = dir
+	if out, err := test.CombinedOutput(); err != nil {
+		t.Fatalf("go test: %v\n%s", err, out)
+	}
+}
+
+// columnTest generates and type-checks the package of a table with an
+// identity key and col, and returns col as introspect typed it along with
+// the table's gen file.
+func columnTest(t *testing.T, col columnMeta, opts genOptions) (column, string) {
+	t.Helper()
+	tt := testTable{
+		name:    "things",
+		columns: []columnMeta{{Name: "id", UDTName: "int8", IsIdentity: true}, col},
+		pk:      []string{"id"},
+		indexed: []string{"id"},
+	}
+	dir := generateTest(t, tt, opts)
+	typeCheck(t, dir)
+	src, err := os.ReadFile(filepath.Join(dir, "things_model_gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return introspectTest(t, tt, opts).Columns[1], string(src)
+}
+
+// hasField reports whether src declares a struct field name of type typ.
+func hasField(src, name, typ string) bool {
+	return regexp.MustCompile(`(?m)^\s*` + name + `\s+` + regexp.QuoteMeta(typ) + `(\s|$)`).MatchString(src)
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+func columnNames(cols []column) []string {
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.ColName
+	}
+	return names
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// recorderTest is a test file for goTest with a database driver that
+// records the statements it's given instead of running them.
+const recorderTest = `package model
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+)
+
+// recorder is a database driver that records the statements it's given,
+// executes none and returns no rows.
+type recorder struct{ queries []string }
+
+func (r *recorder) Connect(context.Context) (driver.Conn, error) { return r, nil }
+func (r *recorder) Driver() driver.Driver                        { return nil }
+func (r *recorder) Prepare(q string) (driver.Stmt, error) {
+	r.queries = append(r.queries, q)
+	return stmt{}, nil
+}
+func (r *recorder) Close() error              { return nil }
+func (r *recorder) Begin() (driver.Tx, error) { return nil, errors.New("recorder: no transactions") }
+
+type stmt struct{}
+
+func (stmt) Close() error                               { return nil }
+func (stmt) NumInput() int                              { return -1 }
+func (stmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+func (stmt) Query([]driver.Value) (driver.Rows, error)  { return rows{}, nil }
+
+type rows struct{}
+
+func (rows) Columns() []string         { return nil }
+func (rows) Close() error              { return nil }
+func (rows) Next([]driver.Value) error { return io.EOF }
+`
+
+func TestGeneratedColumnsAreNotWritten(t *testing.T) {
+	tt := testTable{
+		name: "orders",
+		columns: []columnMeta{
+			{Name: "id", UDTName: "int8", IsIdentity: true},
+			{Name: "qty", UDTName: "int4"},
+			{Name: "price", UDTName: "numeric"},
+			{Name: "total", UDTName: "numeric", IsGenerated: true},
+		},
+		pk:      []string{"id"},
+		indexed: []string{"id"},
+	}
+	meta := introspectTest(t, tt, testOptions())
+	if names := columnNames(meta.InsertColumns); contains(names, "total") {
+		t.Errorf("InsertColumns = %v, want no total", names)
+	}
+	if names := columnNames(meta.UpdateColumns); contains(names, "total") {
+		t.Errorf("UpdateColumns = %v, want no total", names)
+	}
+	if names := columnNames(meta.Columns); !contains(names, "total") {
+		t.Errorf("Columns = %v, want total in the struct and selects", names)
+	}
+
+	src := renderTest(t, genTpl, meta)
+	for _, line := range strings.Split(src, "\n") {
+		if strings.Contains(line, ".Values(") && strings.Contains(line, ".Total") {
+			t.Errorf("generated column written by an insert: %s", strings.TrimSpace(line))
+		}
+		if strings.Contains(line, `Set("total"`) || strings.Contains(line, "total = EXCLUDED.total") {
+			t.Errorf("generated column written by an update: %s", strings.TrimSpace(line))
+		}
+	}
+}
+
+func TestSoftDeleteColumnIsNotWritten(t *testing.T) {
+	tt := testTable{
+		name: "posts",
+		columns: []columnMeta{
+			{Name: "id", UDTName: "int8", IsIdentity: true},
+			{Name: "title", UDTName: "text"},
+			{Name: "deleted_at", UDTName: "timestamptz", IsNullable: true},
+		},
+		pk:      []string{"id"},
+		indexed: []string{"id"},
+	}
+	meta := introspectTest(t, tt, testOptions())
+	if meta.SoftDeleteColumn != "deleted_at" {
+		t.Fatalf("SoftDeleteColumn = %q, want deleted_at", meta.SoftDeleteColumn)
+	}
+	if names := columnNames(meta.InsertColumns); contains(names, "deleted_at") {
+		t.Errorf("InsertColumns = %v, want no deleted_at", names)
+	}
+	if names := columnNames(meta.UpdateColumns); contains(names, "deleted_at") {
+		t.Errorf("UpdateColumns = %v, want no deleted_at", names)
+	}
+	for _, c := range meta.Columns {
+		if c.ColName == "deleted_at" && c.GoType != "*time.Time" {
+			t.Errorf("deleted_at GoType = %s with the bare null style, want *time.Time", c.GoType)
+		}
+	}
+
+	src := renderTest(t, genTpl, meta)
+	if strings.Contains(src, "EXCLUDED.\"deleted_at\"") || strings.Contains(src, "EXCLUDED.deleted_at") {
+		t.Error("upsert writes the soft delete column")
+	}
+
+	tt.columns[2].IsNullable = false
+	if meta := introspectTest(t, tt, testOptions()); meta.SoftDeleteColumn != "" {
+		t.Errorf("SoftDeleteColumn = %q for a NOT NULL column, want none", meta.SoftDeleteColumn)
+	}
+}
+
+func TestModelTestCompiles(t *testing.T) {
+	tt := testTable{
+		name: "accounts",
+		columns: []columnMeta{
+			{Name: "id", UDTName: "int8", IsIdentity: true},
+			{Name: "email", UDTName: "text"},
+			{Name: "balance", UDTName: "numeric"},
+			{Name: "created_at", UDTName: "timestamptz"},
+			{Name: "deleted_at", UDTName: "timestamptz", IsNullable: true},
+		},
+		pk:      []string{"id"},
+		indexed: []string{"id", "email"},
+		uniques: []uniqueIndex{{Name: "accounts_email_key", Columns: []string{"email"}}},
+	}
+	for name, set := range map[string]func(*genOptions){
+		"default":  func(*genOptions) {},
+		"cache":    func(o *genOptions) { o.Cache = true },
+		"readonly": func(o *genOptions) { o.ReadOnly = true },
+		"both":     func(o *genOptions) { o.Cache, o.ReadOnly = true, true },
+	} {
+		t.Run(name, func(t *testing.T) {
+			opts := testOptions()
+			opts.GenTest = true
+			set(&opts)
+			dir := generateTest(t, tt, opts)
+			if _, err := os.Stat(filepath.Join(dir, "accounts_model_test.go")); err != nil {
+				t.Fatal(err)
+			}
+			typeCheck(t, dir)
+		})
+	}
+}
+
+func TestKeyFallbacksComeFromTheCatalog(t *testing.T) {
+	tt := testTable{
+		name: "events",
+		columns: []columnMeta{
+			{Name: "code", UDTName: "text"},
+			{Name: "at", UDTName: "timestamptz"},
+		},
+	}
+	for _, tc := range []struct {
+		source string
+		set    func(*catalog)
+	}{
+		{"unique constraint", func(c *catalog) { c.uniqueKeys[tt.name] = []string{"code"} }},
+		{"partition primary key", func(c *catalog) { c.partitionKeys[tt.name] = []string{"code", "at"} }},
+	} {
+		cat := tt.catalog()
+		tc.set(cat)
+		// A nil db panics on any query the catalog doesn't answer.
+		meta, err := introspect(nil, cat, "public", tt.name, testOptions())
+		if err != nil {
+			t.Fatalf("%s: %v", tc.source, err)
+		}
+		if meta.PKSource != tc.source {
+			t.Errorf("PKSource = %q, want %q", meta.PKSource, tc.source)
+		}
+	}
+}
+
+func TestIntervalColumn(t *testing.T) {
+	for style, want := range map[string]string{"": "Interval", "pointer": "*Interval", "sql": "sql.Null[Interval]"} {
+		opts := testOptions()
+		opts.NullStyle = style
+		c, src := columnTest(t, columnMeta{Name: "lease", UDTName: "interval", IsNullable: style != ""}, opts)
+		if c.GoType != want {
+			t.Errorf("null style %q: GoType = %s, want %s", style, c.GoType, want)
+		}
+		if !hasField(src, "Lease", "FieldInterval") {
+			t.Errorf("null style %q: no FieldInterval field for lease", style)
+		}
+	}
+}
+
+func TestMoneyColumn(t *testing.T) {
+	c, src := columnTest(t, columnMeta{Name: "price", UDTName: "money"}, testOptions())
+	if c.GoType != "Money" {
+		t.Errorf("GoType = %s, want Money", c.GoType)
+	}
+	if !hasField(src, "Price", "FieldMoney") {
+		t.Error("no FieldMoney field for price")
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	src, err := render(typesTpl, map[string]any{"Package": "model"}, testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	goTest(t, t.TempDir(), map[string]string{
+		"types_gen.go": string(src),
+		"money_test.go": `package model
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestMoneyScan(t *testing.T) {
+	for in, want := range map[string]string{
+		"$1,234.50":  "1234.5",
+		"-$0.99":     "-0.99",
+		"1.234,56 €": "1234.56",
+		"($5.00)":    "-5",
+		"¥1,234":     "1234",
+	} {
+		var m Money
+		if err := m.Scan([]byte(in)); err != nil {
+			t.Errorf("Scan(%q): %v", in, err)
+		} else if !m.Equal(decimal.RequireFromString(want)) {
+			t.Errorf("Scan(%q) = %s, want %s", in, m, want)
+		}
+	}
+}
+`,
+	})
+}
+
+func TestSchemaQualifiedSQL(t *testing.T) {
+	tt := testTable{
+		schema: "billing",
+		name:   "invoices",
+		columns: []columnMeta{
+			{Name: "id", UDTName: "int8", IsIdentity: true},
+			{Name: "total", UDTName: "numeric"},
+		},
+		pk:      []string{"id"},
+		indexed: []string{"id"},
+	}
+	goTest(t, generateTest(t, tt, testOptions()), map[string]string{
+		"recorder_test.go": recorderTest,
+		"schema_test.go": `package model
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/zeromicro/go-zero/core/stores/sqlx"
+)
+
+func TestSchemaQualifiedSQL(t *testing.T) {
+	r := &recorder{}
+	m := newInvoicesModel(sqlx.NewSqlConnFromDB(sql.OpenDB(r)))
+	ctx := context.Background()
+	for name, call := range map[string]func(){
+		"Insert":  func() { m.Insert(ctx, &Invoices{}) },
+		"FindOne": func() { m.FindOne(ctx, 1) },
+		"Update":  func() { m.Update(ctx, &Invoices{Id: 1}) },
+		"Delete":  func() { m.Delete(ctx, 1) },
+	} {
+		r.queries = nil
+		call()
+		if len(r.queries) == 0 {
+			t.Errorf("%s ran no statement", name)
+		}
+		for _, q := range r.queries {
+			if !strings.Contains(q, ` + "`" + `"billing"."invoices"` + "`" + `) {
+				t.Errorf("%s: %s", name, q)
+			}
+		}
+	}
+}
+`,
+	})
+}
+
+func TestReservedWordColumn(t *testing.T) {
+	tt := testTable{
+		name: "orders",
+		columns: []columnMeta{
+			{Name: "id%x", UDTName: "int8", IsIdentity: true},
+			{Name: "select", UDTName: "text"},
+		},
+		pk:      []string{"id%x"},
+		indexed: []string{"id%x"},
+	}
+	opts := testOptions()
+	opts.GenTest = true
+	dir := generateTest(t, tt, opts)
+	typeCheck(t, dir)
+	src, err := os.ReadFile(filepath.Join(dir, "orders_model_gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`ordersRows\s+= .*\\"select\\"`).Match(src) {
+		t.Error(`ordersRows doesn't quote "select"`)
+	}
+	goTest(t, dir, map[string]string{
+		"recorder_test.go": recorderTest,
+		"reserved_test.go": `package model
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/zeromicro/go-zero/core/stores/sqlx"
+)
+
+func TestReservedWordColumn(t *testing.T) {
+	r := &recorder{}
+	m := newOrdersModel(sqlx.NewSqlConnFromDB(sql.OpenDB(r)))
+	ctx := context.Background()
+	for _, tc := range []struct {
+		call func()
+		want string
+	}{
+		{func() { m.Insert(ctx, &Orders{Select: "a"}) }, ` + "`" + `("select") VALUES` + "`" + `},
+		{func() { m.Update(ctx, &Orders{IdX: 1, Select: "a"}) }, ` + "`" + `SET "select" = $1` + "`" + `},
+		{func() { m.FindOne(ctx, 1) }, ` + "`" + `where "id%x" = $1` + "`" + `},
+		{func() { m.Exists(ctx, 1) }, ` + "`" + `where "id%x" = $1` + "`" + `},
+		{func() { m.Delete(ctx, 1) }, ` + "`" + `where "id%x" = $1` + "`" + `},
+		{func() { m.Upsert(ctx, &Orders{IdX: 1, Select: "a"}) }, ` + "`" + `"select" = EXCLUDED."select"` + "`" + `},
+	} {
+		r.queries = nil
+		tc.call()
+		if len(r.queries) != 1 || !strings.Contains(r.queries[0], tc.want) {
+			t.Errorf("got %q, want a statement with %s", r.queries, tc.want)
+		}
+	}
+}
+`,
+	})
+}
+
+func TestCharColumn(t *testing.T) {
+	for trim, want := range map[bool]string{false: "string", true: "Char"} {
+		opts := testOptions()
+		opts.TrimChar = trim
+		c, _ := columnTest(t, columnMeta{Name: "code", UDTName: "bpchar"}, opts)
+		if c.GoType != want {
+			t.Errorf("--trim-char=%v: GoType = %s, want %s", trim, c.GoType, want)
+		}
+		if padded := strings.Contains(c.Comment, "padded"); padded == trim {
+			t.Errorf("--trim-char=%v: comment %q", trim, c.Comment)
+		}
+	}
+}
+
+func TestBitAndNetworkColumns(t *testing.T) {
+	// The samples of the generated round-trip test must be valid input.
+	for udt, sample := range map[string]string{
+		"bit":     `"1"`,
+		"varbit":  `"1"`,
+		"inet":    `"10.0.0.1"`,
+		"cidr":    `"10.0.0.0/8"`,
+		"macaddr": `"08:00:2b:01:02:03"`,
+	} {
+		c, src := columnTest(t, columnMeta{Name: "value", UDTName: udt}, testOptions())
+		if got := sampleValue(c.GoType, udt); c.GoType != "string" || got != sample {
+			t.Errorf("%s: GoType = %s, sample %s; want string, %s", udt, c.GoType, got, sample)
+		}
+		if !hasField(src, "Value", "FieldString") {
+			t.Errorf("%s: no FieldString field", udt)
+		}
+	}
+}
+
+func TestTimeColumn(t *testing.T) {
+	opts := testOptions()
+	opts.GenTest = true
+	c, src := columnTest(t, columnMeta{Name: "opens_at", UDTName: "time"}, opts)
+	if c.GoType != "TimeOfDay" {
+		t.Errorf("GoType = %s, want TimeOfDay", c.GoType)
+	}
+	if !hasField(src, "OpensAt", "FieldTimeOfDay") {
+		t.Error("no FieldTimeOfDay field for opens_at")
+	}
+	// Only the sample of the round-trip test, built with time.Date, needs
+	// the time package; typeCheck has failed on a missing or unused import.
+	if strings.Contains(src, `"time"`) {
+		t.Error(`the model imports "time"`)
+	}
+}
+
+func TestGeometryColumn(t *testing.T) {
+	for _, udt := range []string{"geometry", "geography"} {
+		c, src := columnTest(t, columnMeta{Name: "location", UDTName: udt}, testOptions())
+		if c.GoType != "EWKB" {
+			t.Errorf("%s: GoType = %s, want EWKB", udt, c.GoType)
+		}
+		if !hasField(src, "Location", "FieldEWKB") {
+			t.Errorf("%s: no FieldEWKB field", udt)
+		}
+	}
+}
+
+func TestRangeColumns(t *testing.T) {
+	opts := testOptions()
+	opts.GenTest = true
+	for udt, want := range map[string]string{
+		"int4range": "Range[int32]",
+		"int8range": "Range[int64]",
+		"numrange":  "Range[decimal.Decimal]",
+		"tsrange":   "Range[time.Time]",
+		"tstzrange": "Range[time.Time]",
+		"daterange": "Range[time.Time]",
+	} {
+		c, src := columnTest(t, columnMeta{Name: "period", UDTName: udt}, opts)
+		if c.GoType != want {
+			t.Errorf("%s: GoType = %s, want %s", udt, c.GoType, want)
+		}
+		if !hasField(src, "Period", "FieldRange") {
+			t.Errorf("%s: no FieldRange field", udt)
+		}
+	}
+}
+
+func TestTagUsesColumnName(t *testing.T) {
+	c, src := columnTest(t, columnMeta{Name: "userID", UDTName: "int8"}, testOptions())
+	if !strings.Contains(c.Tags, `db:"userID"`) {
+		t.Errorf("Tags = %s, want db:\"userID\"", c.Tags)
+	}
+	if !regexp.MustCompile(`thingsRows\s+= .*\\"userID\\"`).MatchString(src) {
+		t.Error(`thingsRows doesn't quote "userID"`)
+	}
+}
+
+func TestAcronyms(t *testing.T) {
+	golint := testOptions()
+	golint.Initialisms = map[string]bool{"SKU": true}
+	for s := range golintInitialisms {
+		golint.Initialisms[s] = true
+	}
+	for _, tc := range []struct {
+		name       string
+		opts       genOptions
+		camel      []string
+		lowerCamel string
+		lowerType  string
+	}{
+		{"legacy", testOptions(), []string{"Id", "ApiUrl", "UserId", "ItemSku"}, "apiUrl", "idCards"},
+		{"golint", golint, []string{"ID", "APIURL", "UserID", "ItemSKU"}, "apiURL", "idCards"},
+	} {
+		for i, s := range []string{"id", "api_url", "user_id", "item_sku"} {
+			if got := toCamel(s, tc.opts); got != tc.camel[i] {
+				t.Errorf("%s: toCamel(%s) = %s, want %s", tc.name, s, got, tc.camel[i])
+			}
+		}
+		if got := toLowerCamel("api_url", tc.opts); got != tc.lowerCamel {
+			t.Errorf("%s: toLowerCamel(api_url) = %s, want %s", tc.name, got, tc.lowerCamel)
+		}
+		typeName := typeNameOf("id_cards", tc.opts)
+		if got := lowerTypeNameOf("id_cards", typeName, tc.opts); got != tc.lowerType {
+			t.Errorf("%s: lowerTypeNameOf(%s) = %s, want %s", tc.name, typeName, got, tc.lowerType)
+		}
+		c, _ := columnTest(t, columnMeta{Name: "user_id", UDTName: "int8"}, tc.opts)
+		if c.Field != tc.camel[2] {
+			t.Errorf("%s: Field = %s, want %s", tc.name, c.Field, tc.camel[2])
+		}
+	}
+}
+
+func TestExpressionIndexIsIgnored(t *testing.T) {
+	tt := testTable{
+		name: "users",
+		columns: []columnMeta{
+			{Name: "id", UDTName: "int8", IsIdentity: true},
+			{Name: "email", UDTName: "text"},
+		},
+		pk:      []string{"id"},
+		indexed: []string{"id"},
+		// readUniqueIndexes leaves out users_lower_email_key, which is
+		// unique on lower(email), so it only shows up here.
+		exprs: []string{"users_lower_email_idx: lower(email)", "users_lower_email_key: lower(email)"},
+	}
+	opts := testOptions()
+	opts.Cache = true
+	meta := introspectTest(t, tt, opts)
+	if got := columnNames(meta.IndexedColumns); len(got) != 1 || got[0] != "id" {
+		t.Errorf("IndexedColumns = %v, want [id]", got)
+	}
+	if len(meta.IndexExpressions) != 2 || len(meta.UniqueIndexes) != 0 {
+		t.Errorf("IndexExpressions = %v, UniqueIndexes = %v", meta.IndexExpressions, meta.UniqueIndexes)
+	}
+	dir := generateTest(t, tt, opts)
+	typeCheck(t, dir)
+	src, err := os.ReadFile(filepath.Join(dir, "users_model_gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"FindOneByEmail", "cachePublicUsersEmailPrefix"} {
+		if strings.Contains(string(src), s) {
+			t.Errorf("model has %s", s)
+		}
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	src, err := render(errorsTpl, map[string]any{"Package": "model"}, testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	goTest(t, t.TempDir(), map[string]string{
+		"errors_gen.go": string(src),
+		"errors_test.go": `package model
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestClassifyError(t *testing.T) {
+	pqErr := &pq.Error{Code: "23505", Constraint: "x"}
+	err := ClassifyError(fmt.Errorf("insert: %w", pqErr))
+	if !errors.Is(err, ErrDuplicate) {
+		t.Errorf("got %v, want ErrDuplicate", err)
+	}
+	var ce *ConstraintError
+	if !errors.As(err, &ce) || ce.Constraint != "x" {
+		t.Errorf("got %#v, want constraint x", err)
+	}
+	var got *pq.Error
+	if !errors.As(err, &got) || got != pqErr {
+		t.Errorf("got %v, want the *pq.Error", err)
+	}
+	if other := errors.New("other"); ClassifyError(other) != other {
+		t.Error("ClassifyError changed an error that isn't a *pq.Error")
+	}
+}
+`,
+	})
+}
+
+func TestOutputIsStable(t *testing.T) {
+	fk := func(name, col, ref string) foreignKey {
+		return foreignKey{Name: name, Columns: []column{{ColName: col}}, RefSchema: "public", RefTable: ref, RefQuoted: quoteQualified("public", ref), RefColumns: []string{"id"}}
+	}
+	tt := testTable{
+		name: "posts",
+		columns: []columnMeta{
+			{Name: "id", UDTName: "int8", IsIdentity: true},
+			{Name: "slug", UDTName: "text"},
+			{Name: "title", UDTName: "text"},
+			{Name: "author_id", UDTName: "int8"},
+			{Name: "editor_id", UDTName: "int8"},
+		},
+		pk:      []string{"id"},
+		indexed: []string{"id", "slug", "title"},
+		uniques: []uniqueIndex{
+			{Name: "posts_slug_key", Columns: []string{"slug"}},
+			{Name: "posts_title_key", Columns: []string{"title"}},
+		},
+		fks: []foreignKey{fk("posts_author_id_fkey", "author_id", "users"), fk("posts_editor_id_fkey", "editor_id", "users")},
+	}
+	opts := testOptions()
+	opts.GenTest = true
+	first := generateTest(t, tt, opts)
+
+	// The catalog may list the keys in another order.
+	tt.uniques = []uniqueIndex{tt.uniques[1], tt.uniques[0]}
+	tt.fks = []foreignKey{tt.fks[1], tt.fks[0]}
+	second := generateTest(t, tt, opts)
+
+	entries, err := os.ReadDir(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		a, err := os.ReadFile(filepath.Join(first, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadFile(filepath.Join(second, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(a, b) {
+			t.Errorf("%s differs between the runs", e.Name())
+		}
+	}
+}
+
+func TestNoKeyIsSkippable(t *testing.T) {
+	tt := testTable{name: "events", columns: []columnMeta{{Name: "payload", UDTName: "text"}}}
+	_, err := introspect(nil, tt.catalog(), "public", tt.name, testOptions())
+	if !errors.Is(err, errNoKey) {
+		t.Errorf("got %v, want errNoKey", err)
+	}
+	opts := testOptions()
+	opts.AllowNoKey = true
+	if meta := introspectTest(t, tt, opts); meta.PKSource != "none" {
+		t.Errorf("PKSource = %s, want none", meta.PKSource)
+	}
+}
+
+func TestEnumsOfOtherSchemas(t *testing.T) {
+	enum := func(schema, typSchema string) enumMeta {
+		typeName, fileBase := pgTypeNames(schema, typSchema, "status", testOptions())
+		return enumMeta{Schema: typSchema, Name: "status", TypeName: typeName, FileBase: fileBase,
+			Values: []enumValue{{Label: "active", Const: typeName + "Active"}}}
+	}
+	table := func(schema, name string) testTable {
+		return testTable{
+			schema: schema,
+			name:   name,
+			columns: []columnMeta{
+				{Name: "id", UDTName: "int8", IsIdentity: true},
+				{Name: "status", UDTName: "status"},
+			},
+			pk:      []string{"id"},
+			indexed: []string{"id"},
+			enums:   []enumMeta{enum(schema, schema)},
+		}
+	}
+
+	tt := table("public", "users")
+	tt.enums = []enumMeta{enum("public", "auth")}
+	dir := generateTest(t, tt, testOptions())
+	typeCheck(t, dir)
+	if _, err := os.Stat(filepath.Join(dir, "auth_status_enum_gen.go")); err != nil {
+		t.Errorf("auth.status in public: %v", err)
+	}
+
+	// public.users and auth.sessions each use the status of their schema;
+	// in one package the second would overwrite the first.
+	dir = t.TempDir()
+	g := &generator{opts: testOptions(), written: map[string]bool{}, typeFiles: map[string]string{}, bundles: map[string]*bundle{}}
+	var err error
+	for _, tt := range []testTable{table("public", "users"), table("auth", "sessions")} {
+		j := &tableJob{schema: tt.schema, table: tt.name, dir: dir, pkg: "model", cat: tt.catalog()}
+		if _, err = g.generate(j); err != nil {
+			break
+		}
+	}
+	if err == nil || !strings.Contains(err.Error(), "auth.status") {
+		t.Errorf("got %v, want an error naming auth.status", err)
+	}
+
+	tt = table("public", "users")
+	tt.columns = append(tt.columns, columnMeta{Name: "auth_status", UDTName: "status"})
+	tt.enums = append(tt.enums, enum("public", "auth"))
+	if _, err := introspect(nil, tt.catalog(), "public", "users", testOptions()); err == nil {
+		t.Error("no error for a table using public.status and auth.status")
+	}
+}
+
+func TestCompositesOfOtherSchemas(t *testing.T) {
+	composite := func(schema, typSchema string) compositeMeta {
+		typeName, fileBase := pgTypeNames(schema, typSchema, "address", testOptions())
+		return compositeMeta{Schema: typSchema, Name: "address", TypeName: typeName, FileBase: fileBase,
+			Attrs:   []compositeAttr{{Name: "city", Field: "City", GoType: "string", Kind: "string", UDT: "text"}},
+			Imports: []string{`"database/sql/driver"`, `"fmt"`}}
+	}
+	table := func(schema, name string) testTable {
+		return testTable{
+			schema: schema,
+			name:   name,
+			columns: []columnMeta{
+				{Name: "id", UDTName: "int8", IsIdentity: true},
+				{Name: "address", UDTName: "address"},
+			},
+			pk:      []string{"id"},
+			indexed: []string{"id"},
+			comps:   []compositeMeta{composite(schema, schema)},
+		}
+	}
+
+	tt := table("public", "users")
+	tt.comps = []compositeMeta{composite("public", "auth")}
+	dir := generateTest(t, tt, testOptions())
+	typeCheck(t, dir)
+	if _, err := os.Stat(filepath.Join(dir, "auth_address_composite_gen.go")); err != nil {
+		t.Errorf("auth.address in public: %v", err)
+	}
+
+	dir = t.TempDir()
+	g := &generator{opts: testOptions(), written: map[string]bool{}, typeFiles: map[string]string{}, bundles: map[string]*bundle{}}
+	var err error
+	for _, tt := range []testTable{table("public", "users"), table("auth", "sessions")} {
+		j := &tableJob{schema: tt.schema, table: tt.name, dir: dir, pkg: "model", cat: tt.catalog()}
+		if _, err = g.generate(j); err != nil {
+			break
+		}
+	}
+	if err == nil || !strings.Contains(err.Error(), "auth.address") {
+		t.Errorf("got %v, want an error naming auth.address", err)
+	}
+
+	tt = table("public", "users")
+	tt.columns = append(tt.columns, columnMeta{Name: "auth_address", UDTName: "address"})
+	tt.comps = append(tt.comps, composite("public", "auth"))
+	if _, err := introspect(nil, tt.catalog(), "public", "users", testOptions()); err == nil {
+		t.Error("no error for a table using public.address and auth.address")
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// singleFileName is the file --single-file writes in each output directory.
+const singleFileName = "models_gen.go"
+
+// bundle collects the generated sources of one output package when
+// --single-file is set.
+type bundle struct {
+	pkg     string
+	sources [][]byte
+}
+
+// bundledSource is one rendered file waiting to go into a bundle.
+type bundledSource struct {
+	path string
+	pkg  string
+	src  []byte
+}
+
+// mergeSources combines generated files of one package into a single file:
+// the header comment of the first source is kept, the package clause is
+// written once and the imports of all sources are merged and deduplicated.
+func mergeSources(pkg string, sources [][]byte) ([]byte, error) {
+	imports := map[string]bool{}
+	var header, body bytes.Buffer
+	for i, src := range sources {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "", src, parser.ImportsOnly|parser.ParseComments)
+		if err != nil {
+			return nil, fmt.Errorf("merge: %w", err)
+		}
+		if i == 0 {
+			header.Write(src[:fset.Position(f.Package).Offset])
+		}
+		for _, spec := range f.Imports {
+			imports[importSpec(spec)] = true
+		}
+
+		// Everything after the import declarations (or the package clause
+		// when there are none) is copied as is, comments included.
+		end := fset.Position(f.Name.End()).Offset
+		if n := len(f.Decls); n > 0 {
+			end = fset.Position(f.Decls[n-1].End()).Offset
+		}
+		body.WriteString("\n")
+		body.Write(src[end:])
+	}
+
+	var out bytes.Buffer
+	out.Write(header.Bytes())
+	fmt.Fprintf(&out, "package %s\n\n", pkg)
+	writeImportBlock(&out, imports)
+	out.Write(body.Bytes())
+	return format.Source(out.Bytes())
+}
+
+// writeImportBlock writes the import specs (`"path"` or `name "path"`) as a
+// single declaration, standard library first like goimports.
+func writeImportBlock(out *bytes.Buffer, imports map[string]bool) {
+	if len(imports) == 0 {
+		return
+	}
+	sorted := make([]string, 0, len(imports))
+	for imp := range imports {
+		sorted = append(sorted, imp)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return importPath(sorted[i]) < importPath(sorted[j]) })
+
+	out.WriteString("import (\n")
+	for _, std := range []bool{true, false} {
+		group := 0
+		for _, imp := range sorted {
+			if isStdImport(imp) == std {
+				fmt.Fprintf(out, "\t%s\n", imp)
+				group++
+			}
+		}
+		if std && group > 0 {
+			out.WriteString("\n")
+		}
+	}
+	out.WriteString(")\n")
+}
+
+// knownImports are the packages generated code may use, by package name.
+// fixImports adds them wherever they are used but not imported.
+var knownImports = map[string]string{
+	"context":  `"context"`,
+	"driver":   `"database/sql/driver"`,
+	"errors":   `"errors"`,
+	"fmt":      `"fmt"`,
+	"hex":      `"encoding/hex"`,
+	"json":     `"encoding/json"`,
+	"sql":      `"database/sql"`,
+	"strconv":  `"strconv"`,
+	"strings":  `"strings"`,
+	"time":     `"time"`,
+	"cache":    `"github.com/zeromicro/go-zero/core/stores/cache"`,
+	"decimal":  `"github.com/shopspring/decimal"`,
+	"pq":       `"github.com/lib/pq"`,
+	"sqlc":     `"github.com/zeromicro/go-zero/core/stores/sqlc"`,
+	"sqlx":     `"github.com/zeromicro/go-zero/core/stores/sqlx"`,
+	"squirrel": `"github.com/Masterminds/squirrel"`,
+	"stringx":  `"github.com/zeromicro/go-zero/core/stringx"`,
+}
+
+// fixImports makes the imports of src match what it uses: imports it
+// doesn't use are dropped, knownImports it uses are added, and the result
+// is grouped like writeImportBlock. The import set a template is given is
+// then only a starting point, for packages like those of @gotype that
+// can't be told from their use. Imports whose package name can't be told
+// from the path are kept, and src with several import declarations or that
+// doesn't parse is returned as is.
+func fixImports(src []byte) []byte {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return src
+	}
+	var decl *ast.GenDecl
+	for _, d := range f.Decls {
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			if decl != nil {
+				return src
+			}
+			decl = gd
+		}
+	}
+
+	// Package names used in the file are unresolved identifiers in front of
+	// a selector.
+	used := map[string]bool{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+	imports := map[string]bool{}
+	imported := map[string]bool{}
+	for _, spec := range f.Imports {
+		name := importName(spec)
+		if name == "" || name == "_" || name == "." || used[name] {
+			imports[importSpec(spec)] = true
+		}
+		imported[name] = true
+	}
+	missing := false
+	for name := range used {
+		if imp, ok := knownImports[name]; ok && !imported[name] {
+			imports[imp] = true
+			missing = true
+		}
+	}
+	if decl == nil && !missing {
+		return src
+	}
+
+	var block bytes.Buffer
+	writeImportBlock(&block, imports)
+	var out bytes.Buffer
+	if decl == nil {
+		// No import declaration yet: add one after the package clause.
+		end := fset.Position(f.Name.End()).Offset
+		out.Write(src[:end])
+		out.WriteString("\n\n")
+		out.Write(bytes.TrimSuffix(block.Bytes(), []byte("\n")))
+		out.Write(src[end:])
+		return out.Bytes()
+	}
+	out.Write(src[:fset.Position(decl.Pos()).Offset])
+	out.Write(bytes.TrimSuffix(block.Bytes(), []byte("\n")))
+	out.Write(src[fset.Position(decl.End()).Offset:])
+	return out.Bytes()
+}
+
+// importName returns the name an import is used by: its explicit name, or
+// the last path element without a major version suffix. It returns "" when
+// that element isn't an identifier, as the package name may be anything.
+func importName(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	elems := strings.Split(importPath(spec.Path.Value), "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		name = elems[len(elems)-2]
+	}
+	if !token.IsIdentifier(name) {
+		return ""
+	}
+	return name
+}
+
+// importSpec formats an import as `"path"` or `name "path"`.
+func importSpec(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name + " " + spec.Path.Value
+	}
+	return spec.Path.Value
+}
+
+// importPath returns the unquoted path of an import spec written as
+// `"path"` or `name "path"`.
+func importPath(imp string) string {
+	if i := strings.IndexByte(imp, '"'); i > 0 {
+		imp = imp[i:]
+	}
+	p, err := strconv.Unquote(imp)
+	if err != nil {
+		return imp
+	}
+	return p
+}
+
+// isStdImport reports whether an import spec refers to the standard
+// library, i.e. its first path element has no dot.
+func isStdImport(imp string) bool {
+	p := importPath(imp)
+	if i := strings.IndexByte(p, '/'); i >= 0 {
+		p = p[:i]
+	}
+	return !strings.Contains(p, ".")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path"
+	"strings"
+)
+
+// Hand-written code in a *_model.go wrapper survives regeneration when it
+// sits between these markers. Text after "// region custom" names the
+// region; the template has one in the model interface and one at the end
+// of the file.
+const (
+	regionStart = "// region custom"
+	regionEnd   = "// endregion"
+)
+
+// region is the content of one marked block, without the marker lines.
+type region struct {
+	marker string
+	lines  []string
+}
+
+// parseRegions returns the marked blocks of src in order.
+func parseRegions(src []byte) ([]region, error) {
+	var out []region
+	var cur *region
+	for i, line := range strings.Split(string(src), "\n") {
+		t := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(t, regionStart):
+			if cur != nil {
+				return nil, fmt.Errorf("line %d: nested %q", i+1, t)
+			}
+			cur = &region{marker: t}
+		case t == regionEnd:
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: %q without %q", i+1, regionEnd, regionStart)
+			}
+			out = append(out, *cur)
+			cur = nil
+		case cur != nil:
+			cur.lines = append(cur.lines, line)
+		}
+	}
+	if cur != nil {
+		return nil, fmt.Errorf("%q is not closed", cur.marker)
+	}
+	return out, nil
+}
+
+// mergeRegions replaces the marked blocks of the freshly rendered src with
+// the kept ones, matching them by marker line. Kept blocks the template no
+// longer has are appended at the end so no code is lost. Imports of old
+// that the kept code refers to are carried over.
+func mergeRegions(src, old []byte, kept []region) ([]byte, error) {
+	used := make([]bool, len(kept))
+	take := func(marker string) ([]string, bool) {
+		for i, r := range kept {
+			if !used[i] && r.marker == marker {
+				used[i] = true
+				return r.lines, true
+			}
+		}
+		return nil, false
+	}
+
+	var out bytes.Buffer
+	skipping := false
+	for _, line := range strings.Split(strings.TrimSuffix(string(src), "\n"), "\n") {
+		t := strings.TrimSpace(line)
+		switch {
+		case skipping && t == regionEnd:
+			skipping = false
+		case skipping:
+			continue
+		case strings.HasPrefix(t, regionStart):
+			if lines, ok := take(t); ok {
+				out.WriteString(line + "\n")
+				for _, l := range lines {
+					out.WriteString(l + "\n")
+				}
+				skipping = true
+				continue
+			}
+		}
+		out.WriteString(line + "\n")
+	}
+	for i, r := range kept {
+		if used[i] {
+			continue
+		}
+		fmt.Fprintf(&out, "\n%s\n", r.marker)
+		for _, l := range r.lines {
+			out.WriteString(l + "\n")
+		}
+		out.WriteString(regionEnd + "\n")
+	}
+	merged, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return keepImports(merged, old, kept)
+}
+
+// keepImports adds the imports of old that src lacks and whose package name
+// is used as name. in the kept regions.
+func keepImports(src, old []byte, kept []region) ([]byte, error) {
+	var code strings.Builder
+	for _, r := range kept {
+		for _, l := range r.lines {
+			code.WriteString(l + "\n")
+		}
+	}
+
+	oldFile, err := parser.ParseFile(token.NewFileSet(), "", old, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	imports := map[string]bool{}
+	for _, spec := range f.Imports {
+		imports[importSpec(spec)] = true
+	}
+	added := false
+	for _, spec := range oldFile.Imports {
+		imp := importSpec(spec)
+		name := path.Base(importPath(imp))
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if !imports[imp] && strings.Contains(code.String(), name+".") {
+			imports[imp] = true
+			added = true
+		}
+	}
+	if !added {
+		return src, nil
+	}
+
+	// Replace the import declarations with a single merged one.
+	start := fset.Position(f.Name.End()).Offset
+	end := start
+	for _, d := range f.Decls {
+		if g, ok := d.(*ast.GenDecl); ok && g.Tok == token.IMPORT {
+			end = fset.Position(g.End()).Offset
+		}
+	}
+	var out bytes.Buffer
+	out.Write(src[:start])
+	out.WriteString("\n\n")
+	writeImportBlock(&out, imports)
+	out.Write(src[end:])
+	return format.Source(out.Bytes())
+}